@@ -0,0 +1,277 @@
+package posting
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// AnalyzerFunc turns a raw string value into the token stream that
+// should be indexed for it. Tokenizers and token filters are plain
+// building blocks composed into an AnalyzerFunc by newAnalyzer; external
+// packages that want something more exotic (a Chinese segmenter, say)
+// can just register any AnalyzerFunc directly.
+type AnalyzerFunc func(value string) []string
+
+// Tokenizer splits a raw string into an initial token stream.
+type Tokenizer func(value string) []string
+
+// TokenFilter transforms a token stream into another one: lowercasing,
+// stemming, dropping stopwords, and so on. Filters run in the order
+// they're given to newAnalyzer.
+type TokenFilter func(tokens []string) []string
+
+var (
+	analyzersMu sync.RWMutex
+	analyzers   = make(map[string]AnalyzerFunc)
+
+	// tokenizerIDs assigns each registered analyzer a one-byte id that's
+	// prefixed onto every token it produces, so that index keys from
+	// different analyzers on the same attr never collide. "term" and
+	// "exact" share 0x01: they run the same analyzer, so their tokens
+	// are identical anyway.
+	tokenizerIDs = map[string]byte{
+		"int":        0x06,
+		"float":      0x07,
+		"date":       0x03,
+		"datetime":   0x04,
+		"term":       0x01,
+		"exact":      0x01,
+		"fulltext":   0x08,
+		"whitespace": 0x09,
+		"ngram":      0x0a,
+	}
+
+	// tokenizerIDMu guards customTokenizerIDs and takenTokenizerIDs.
+	tokenizerIDMu sync.Mutex
+
+	// customTokenizerIDs caches the id tokenizerID's fallback hash
+	// assigned to a name not in tokenizerIDs, so repeated calls for the
+	// same name don't need to re-walk takenTokenizerIDs to rediscover
+	// it.
+	customTokenizerIDs = make(map[string]byte)
+
+	// takenTokenizerIDs are ids tokenizerID's fallback hash must never
+	// hand out to a second name: every id already assigned by
+	// tokenizerIDs or by a previous fallback-hash call, plus
+	// pendingGenMarker, which tags pending-generation tokens rather
+	// than identifying a tokenizer. Seeded once from tokenizerIDs, then
+	// grown as tokenizerID assigns ids to new custom names, so two
+	// different custom analyzers (e.g. two third-party segmenters
+	// registered via RegisterAnalyzer) can never probe down to the same
+	// id and silently share an index keyspace.
+	takenTokenizerIDs = func() map[byte]bool {
+		r := map[byte]bool{pendingGenMarker: true}
+		for _, id := range tokenizerIDs {
+			r[id] = true
+		}
+		return r
+	}()
+)
+
+// newAnalyzer composes a tokenizer and an ordered list of filters into a
+// single AnalyzerFunc.
+func newAnalyzer(tok Tokenizer, filters ...TokenFilter) AnalyzerFunc {
+	return func(value string) []string {
+		toks := tok(value)
+		for _, f := range filters {
+			toks = f(toks)
+		}
+		return toks
+	}
+}
+
+// RegisterAnalyzer installs fn as the analyzer for name, so that schemas
+// written as `pred: string @index(name)` dispatch to it. Registering
+// under an existing name replaces it. This is the extension point for
+// embedders that need a tokenizer this package doesn't ship, e.g. a
+// Chinese or Japanese segmenter.
+func RegisterAnalyzer(name string, fn AnalyzerFunc) {
+	analyzersMu.Lock()
+	defer analyzersMu.Unlock()
+	analyzers[name] = fn
+}
+
+func getAnalyzer(name string) (AnalyzerFunc, bool) {
+	analyzersMu.RLock()
+	defer analyzersMu.RUnlock()
+	fn, ok := analyzers[name]
+	return fn, ok
+}
+
+// tokenizerID returns the id byte an analyzer's tokens are prefixed
+// with. Names without an entry in tokenizerIDs fall back to hashing
+// the name, so third-party analyzers still get a
+// stable, collision-resistant prefix. The hash never returns an id in
+// takenTokenizerIDs: it walks forward from the hashed value until it
+// lands on a free one, records it there, and caches it in
+// customTokenizerIDs -- so a custom analyzer name can never silently
+// alias a built-in tokenizer's id, pendingGenMarker, or another custom
+// analyzer's id.
+func tokenizerID(name string) byte {
+	if id, ok := tokenizerIDs[name]; ok {
+		return id
+	}
+
+	tokenizerIDMu.Lock()
+	defer tokenizerIDMu.Unlock()
+	if id, ok := customTokenizerIDs[name]; ok {
+		return id
+	}
+
+	var h byte = 0x80
+	for i := 0; i < len(name); i++ {
+		h = h*31 + name[i]
+	}
+	for takenTokenizerIDs[h] {
+		h++
+	}
+	takenTokenizerIDs[h] = true
+	customTokenizerIDs[name] = h
+	return h
+}
+
+func init() {
+	RegisterAnalyzer("term", newAnalyzer(singleTermTokenizer, lowercaseFilter))
+	RegisterAnalyzer("exact", newAnalyzer(singleTermTokenizer, lowercaseFilter))
+	RegisterAnalyzer("whitespace", newAnalyzer(whitespaceTokenizer, lowercaseFilter))
+	RegisterAnalyzer("fulltext", newAnalyzer(unicodeWordTokenizer,
+		lowercaseFilter, nfkcNormalizeFilter, asciiFoldingFilter, stopwordFilter, porterStemFilter))
+}
+
+// singleTermTokenizer treats the whole value as one token, for
+// exact-match indexing.
+func singleTermTokenizer(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+// whitespaceTokenizer splits on runs of unicode whitespace.
+func whitespaceTokenizer(value string) []string {
+	return strings.FieldsFunc(value, unicode.IsSpace)
+}
+
+// unicodeWordTokenizer splits into maximal runs of letters/digits,
+// approximating a unicode word-break tokenizer.
+func unicodeWordTokenizer(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// NewNgramTokenizer returns a Tokenizer producing overlapping rune
+// n-grams of length n from each whitespace-separated field of the value.
+func NewNgramTokenizer(n int) Tokenizer {
+	return func(value string) []string {
+		var out []string
+		for _, field := range whitespaceTokenizer(value) {
+			runes := []rune(field)
+			if len(runes) < n {
+				out = append(out, field)
+				continue
+			}
+			for i := 0; i+n <= len(runes); i++ {
+				out = append(out, string(runes[i:i+n]))
+			}
+		}
+		return out
+	}
+}
+
+// lowercaseFilter lowercases every token.
+func lowercaseFilter(tokens []string) []string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = strings.ToLower(t)
+	}
+	return out
+}
+
+// asciiFoldingDiacritics maps common Latin letters-with-diacritics to
+// their plain ASCII equivalent.
+var asciiFoldingDiacritics = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ñ': 'n', 'ç': 'c', 'ý': 'y',
+}
+
+// asciiFoldingFilter strips diacritics from Latin letters, so e.g.
+// "café" and "cafe" index to the same term.
+func asciiFoldingFilter(tokens []string) []string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = strings.Map(func(r rune) rune {
+			if repl, ok := asciiFoldingDiacritics[r]; ok {
+				return repl
+			}
+			return r
+		}, t)
+	}
+	return out
+}
+
+// nfkcNormalizeFilter folds compatibility variants of a character (full
+// vs. half width, ligatures, etc.) to their canonical form. This is a
+// small, dependency-free approximation of unicode NFKC normalization
+// covering the cases likely to show up in indexed text.
+func nfkcNormalizeFilter(tokens []string) []string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = strings.Map(func(r rune) rune {
+			switch {
+			case r >= 0xFF01 && r <= 0xFF5E: // fullwidth ASCII variants
+				return r - 0xFEE0
+			default:
+				return r
+			}
+		}, t)
+	}
+	return out
+}
+
+// englishStopwords is a small, common-case stopword list; good enough
+// for fulltext search relevance, not meant to be exhaustive.
+var englishStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "has": true, "he": true,
+	"in": true, "is": true, "it": true, "its": true, "of": true, "on": true,
+	"that": true, "the": true, "to": true, "was": true, "were": true, "will": true,
+	"with": true,
+}
+
+// stopwordFilter drops tokens found in englishStopwords.
+func stopwordFilter(tokens []string) []string {
+	out := tokens[:0]
+	for _, t := range tokens {
+		if !englishStopwords[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// porterStemFilter trims at most one suffix per token from a short,
+// Porter-inspired list (plural/verb-tense endings plus a few
+// derivational ones such as "ational" and "iveness"). It's not a full
+// Porter implementation.
+func porterStemFilter(tokens []string) []string {
+	suffixes := []string{"ational", "ization", "fulness", "ousness",
+		"iveness", "ing", "edly", "ies", "ied", "ed", "es", "s"}
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		stemmed := t
+		for _, suf := range suffixes {
+			if len(t) > len(suf)+2 && strings.HasSuffix(t, suf) {
+				stemmed = strings.TrimSuffix(t, suf)
+				break
+			}
+		}
+		out[i] = stemmed
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package posting
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterAnalyzerIsDispatchedByName(t *testing.T) {
+	RegisterAnalyzer("reverse-test", func(value string) []string {
+		runes := []rune(value)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return []string{string(runes)}
+	})
+
+	fn, ok := getAnalyzer("reverse-test")
+	require.True(t, ok)
+	require.Equal(t, []string{"trac"}, fn("cart"))
+}
+
+func TestNewNgramTokenizer(t *testing.T) {
+	trigram := NewNgramTokenizer(3)
+	require.Equal(t, []string{"wal", "alk", "lki", "kin", "ing"}, trigram("walking"))
+
+	// A field shorter than n is kept whole rather than dropped.
+	require.Equal(t, []string{"hi"}, trigram("hi"))
+
+	// Each whitespace-separated field is n-grammed independently.
+	require.Equal(t, []string{"abc", "xyz"}, trigram("abc xyz"))
+}
+
+func TestAsciiFoldingFilter(t *testing.T) {
+	out := asciiFoldingFilter([]string{"café", "naïve", "plain"})
+	require.Equal(t, []string{"cafe", "naive", "plain"}, out)
+}
+
+func TestNfkcNormalizeFilter(t *testing.T) {
+	// U+FF21 is the fullwidth form of 'A'; it should fold to its
+	// canonical ASCII counterpart.
+	out := nfkcNormalizeFilter([]string{"ＡＢＣ"})
+	require.Equal(t, []string{"ABC"}, out)
+}
+
+// TestTokenizerIDFallbackHashAvoidsCrossNameCollisions guards against
+// two different custom analyzer names (e.g. two third-party segmenters
+// registered via RegisterAnalyzer) probing down to the same id: that
+// would make them silently share an index keyspace for any attr that
+// used both, so a query against one's tokenizer could match postings
+// written by the other.
+func TestTokenizerIDFallbackHashAvoidsCrossNameCollisions(t *testing.T) {
+	seen := make(map[byte]string)
+	for i := 0; i < 64; i++ {
+		name := fmt.Sprintf("custom-analyzer-%d", i)
+		id := tokenizerID(name)
+		if other, ok := seen[id]; ok {
+			t.Fatalf("tokenizerID(%q) and tokenizerID(%q) both returned id %#x", name, other, id)
+		}
+		seen[id] = name
+	}
+}
+
+// TestTokenizerIDFallbackHashIsStable checks that repeated calls for
+// the same custom name keep returning the id it was first assigned,
+// since that id is baked into already-written index keys.
+func TestTokenizerIDFallbackHashIsStable(t *testing.T) {
+	id := tokenizerID("custom-analyzer-stable")
+	for i := 0; i < 5; i++ {
+		require.Equal(t, id, tokenizerID("custom-analyzer-stable"))
+	}
+}
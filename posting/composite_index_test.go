@@ -0,0 +1,34 @@
+package posting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/types"
+)
+
+func TestIndexingCompositeString(t *testing.T) {
+	schema.ParseBytes([]byte("nickname:string @index(term, fulltext)"), 1)
+	a, err := IndexTokens("nickname", types.Val{Tid: types.StringID, Value: []byte("The Rivers")})
+	require.NoError(t, err)
+	require.Len(t, a, 2)
+	require.Contains(t, a, "\x01the rivers")
+	require.Contains(t, a, "\x08river")
+}
+
+func TestIndexingCompositeInt(t *testing.T) {
+	schema.ParseBytes([]byte("score:int @index(int, int_range)"), 1)
+	a, err := IndexTokens("score", types.Val{Tid: types.StringID, Value: []byte("7")})
+	require.NoError(t, err)
+	// "int" contributes its single full-precision token; "int_range"
+	// contributes one prefix-coded token per precision level (see
+	// range.go), all tagged with their own tokenizer id so the two
+	// compound indexes can't collide.
+	require.Len(t, a, 1+64/rangeStep)
+	require.EqualValues(t, []byte{tokIdInt, 0x1, 0x0, 0x0, 0x0, 0x7}, []byte(a[0]))
+	for _, tk := range a[1:] {
+		require.EqualValues(t, tokIdIntRange, tk[0])
+	}
+}
@@ -0,0 +1,200 @@
+package posting
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/types"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// pendingGenMarker tags every index token written into a predicate's
+// non-zero generation (see schema.Update.ActiveGen/Pending). Generation
+// 0 is left untagged, so a predicate that never goes through an online
+// index build keeps exactly the key format it always had; tagGen adds
+// this byte only to tokens for generation 1, which a build starts
+// writing as soon as BeginIndexBuild registers it as pending. It's distinct from every tokenizer id in use (see analyzer.go,
+// index.go, range.go), so a tagged and an untagged key can never
+// collide.
+const pendingGenMarker = 0xff
+
+// tagGen prefixes every token in toks with gen's marker, or returns toks
+// unchanged for generation 0.
+func tagGen(gen byte, toks []string) []string {
+	if gen == 0 || len(toks) == 0 {
+		return toks
+	}
+	marker := string([]byte{pendingGenMarker})
+	out := make([]string, len(toks))
+	for i, t := range toks {
+		out[i] = marker + t
+	}
+	return out
+}
+
+// genTokens tokenizes val with the named tokenizers and tags the result
+// for gen, or returns no tokens if has is false (there was no posting to
+// tokenize, or the edge was a delete).
+func genTokens(names []string, gen byte, has bool, val []byte) ([]string, error) {
+	if !has {
+		return nil, nil
+	}
+	toks, err := runTokenizers(names, types.Val{Tid: types.StringID, Value: val})
+	if err != nil {
+		return nil, err
+	}
+	return tagGen(gen, toks), nil
+}
+
+// genIndexPrefix returns the key prefix covering every index entry for
+// pk.Attr written under generation gen.
+func genIndexPrefix(pk x.ParsedKey, gen byte) []byte {
+	prefix := pk.IndexPrefix()
+	if gen == 0 {
+		return prefix
+	}
+	return append(prefix, pendingGenMarker)
+}
+
+// genTokenizerPrefix returns the key prefix covering pk.Attr's index
+// entries produced by the tokenizer identified by id, under generation
+// gen.
+func genTokenizerPrefix(pk x.ParsedKey, gen byte, id byte) []byte {
+	if gen == 0 {
+		return pk.TokenizerPrefix(id)
+	}
+	return append(genIndexPrefix(pk, gen), id)
+}
+
+// buildHandle tracks one attr's in-flight background backfill, so
+// CommitIndexBuild and AbortIndexBuild can wait for it (or cancel it)
+// without blocking BeginIndexBuild's caller.
+type buildHandle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+var (
+	buildsMu sync.Mutex
+	builds   = make(map[string]*buildHandle)
+)
+
+// BeginIndexBuild starts an online index build for attr under tokenizer,
+// launching a backfill of attr's inactive generation from its current
+// data in the background and returning as soon as it's registered -- the
+// backfill itself runs through the same sharded, resumable engine
+// RebuildIndexOpts uses (see rebuildGen), so it no longer blocks the
+// caller for the whole scan. From the moment it's called, every
+// mutation on attr dual-writes its move to the new generation too (see
+// AddMutationWithIndex), so the backfill and live traffic together
+// leave the new generation fully caught up. BuildStatus reports the
+// backfill's progress; the caller must follow up with CommitIndexBuild
+// to make it active (which waits for the backfill to finish first), or
+// AbortIndexBuild to cancel and discard it.
+func BeginIndexBuild(ctx context.Context, attr string, tokenizer []string) error {
+	gen, err := schema.State().BeginBuild(attr, tokenizer)
+	if err != nil {
+		return err
+	}
+
+	buildCtx, cancel := context.WithCancel(ctx)
+	h := &buildHandle{cancel: cancel, done: make(chan struct{})}
+	buildsMu.Lock()
+	builds[attr] = h
+	buildsMu.Unlock()
+
+	// Register fresh progress state before returning, so BuildStatus
+	// sees the build immediately; rebuildGen replaces it once it has
+	// counted attr's uids.
+	rebuildsMu.Lock()
+	rebuilds[rebuildKey{attr, gen}] = &rebuildState{}
+	rebuildsMu.Unlock()
+
+	go func() {
+		defer close(h.done)
+		h.err = rebuildGen(buildCtx, attr, tokenizer, gen, false, RebuildOptions{})
+	}()
+	return nil
+}
+
+// BuildStatus reports the done/total uid counts for attr's in-flight
+// backfill, started by BeginIndexBuild. ok is false if attr has no
+// pending generation.
+func BuildStatus(attr string) (done, total uint64, ok bool) {
+	su, ok := schema.State().Get(attr)
+	if !ok || su.Pending == nil {
+		return 0, 0, false
+	}
+	return genRebuildStatus(attr, su.Pending.Gen)
+}
+
+// awaitBuild blocks until attr's background backfill (if any) finishes,
+// returning the error it finished with, and forgets its handle.
+func awaitBuild(attr string) error {
+	buildsMu.Lock()
+	h, ok := builds[attr]
+	buildsMu.Unlock()
+	if !ok {
+		return nil
+	}
+	<-h.done
+	buildsMu.Lock()
+	delete(builds, attr)
+	buildsMu.Unlock()
+	return h.err
+}
+
+// CommitIndexBuild waits for attr's backfill (started by
+// BeginIndexBuild) to finish, then atomically promotes its pending
+// generation to active, then sweeps the now-superseded generation's
+// index entries from the store.
+func CommitIndexBuild(ctx context.Context, attr string) error {
+	if err := awaitBuild(attr); err != nil {
+		return err
+	}
+	oldGen, oldTokenizer, err := schema.State().CommitBuild(attr)
+	if err != nil {
+		return err
+	}
+	return sweepGen(attr, oldGen, oldTokenizer)
+}
+
+// AbortIndexBuild cancels attr's in-flight backfill (started by
+// BeginIndexBuild) and waits for it to unwind, then discards its
+// pending generation without promoting it, sweeping whatever partial
+// entries the backfill and any dual-written mutations left behind.
+func AbortIndexBuild(ctx context.Context, attr string) error {
+	buildsMu.Lock()
+	h, ok := builds[attr]
+	buildsMu.Unlock()
+	if ok {
+		h.cancel()
+	}
+	if err := awaitBuild(attr); err != nil && err != context.Canceled {
+		return err
+	}
+
+	gen, tokenizer, err := schema.State().AbortBuild(attr)
+	if err != nil {
+		return err
+	}
+	return sweepGen(attr, gen, tokenizer)
+}
+
+// sweepGen deletes every index entry tokenizer produced under attr's
+// generation gen. It drops one tokenizer at a time rather than the
+// whole generation's shared prefix, because generation 0's key format
+// is a byte-prefix of generation 1's (see pendingGenMarker) -- a
+// blanket drop of generation 0 while generation 1 is still live would
+// also delete generation 1's entries.
+func sweepGen(attr string, gen byte, tokenizer []string) error {
+	pk := x.ParsedKey{Attr: attr}
+	for _, name := range tokenizer {
+		if err := dropPrefix(genTokenizerPrefix(pk, gen, tokenizerID(name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
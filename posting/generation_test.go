@@ -0,0 +1,147 @@
+package posting
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/dgraph/protos/taskp"
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/store"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+func newGenerationTestStore(t *testing.T) (string, *store.Store) {
+	dir, err := ioutil.TempDir("", "storetest_")
+	require.NoError(t, err)
+
+	ps, err := store.NewStore(dir)
+	require.NoError(t, err)
+	Init(ps)
+	return dir, ps
+}
+
+func activeIndexKeys(t *testing.T, attr string) map[string][]uint64 {
+	it := pstore.NewIterator()
+	defer it.Close()
+
+	su, ok := schema.State().Get(attr)
+	require.True(t, ok)
+	prefix := genIndexPrefix(x.ParsedKey{Attr: attr}, su.ActiveGen)
+
+	out := make(map[string][]uint64)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		l, _ := GetOrCreate(append([]byte{}, it.Key().Data()...), 0)
+		out[string(it.Key().Data())] = l.Uids()
+	}
+	return out
+}
+
+// TestOnlineIndexBuildSwitchesTokenizer switches "nick" from "term" to
+// "fulltext" via BeginIndexBuild/CommitIndexBuild while mutations keep
+// landing, and checks queries only ever see one generation's entries at
+// a time, ending on the fulltext tokenizer's output.
+func TestOnlineIndexBuildSwitchesTokenizer(t *testing.T) {
+	dir, ps := newGenerationTestStore(t)
+	defer ps.Close()
+	defer os.RemoveAll(dir)
+
+	schema.ParseBytes([]byte("nick:string @index(term)"), 1)
+	addMutationWithIndex(t, getNew(x.DataKey("nick", 1), ps), &taskp.DirectedEdge{
+		Attr: "nick", Entity: 1, Value: []byte("The Walking Man"),
+	}, Set)
+
+	require.NoError(t, BeginIndexBuild(context.Background(), "nick", []string{"fulltext"}))
+
+	// A mutation landing while the build is pending (the backfill runs in
+	// the background) but before commit must still dual-write into both
+	// generations.
+	addMutationWithIndex(t, getNew(x.DataKey("nick", 2), ps), &taskp.DirectedEdge{
+		Attr: "nick", Entity: 2, Value: []byte("Walking Dead"),
+	}, Set)
+
+	require.NoError(t, CommitIndexBuild(context.Background(), "nick"))
+	CommitLists(10)
+	for len(syncCh) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	su, ok := schema.State().Get("nick")
+	require.True(t, ok)
+	require.Equal(t, []string{"fulltext"}, su.Tokenizer)
+
+	entries := activeIndexKeys(t, "nick")
+	// fulltext stems/lowercases and drops stopwords, so "walking" should
+	// now be a shared token across both uids instead of the old
+	// full-string "term" entries.
+	var found bool
+	for _, uids := range entries {
+		if len(uids) == 2 {
+			found = true
+		}
+	}
+	require.True(t, found, "expected a fulltext token shared by both uids, got %v", entries)
+}
+
+// TestBeginIndexBuildRunsInBackground checks that BeginIndexBuild
+// returns as soon as the build is registered, without blocking for the
+// whole backfill, and that BuildStatus can be polled for progress in
+// the meantime; CommitIndexBuild is what actually waits for the
+// backfill to finish.
+func TestBeginIndexBuildRunsInBackground(t *testing.T) {
+	dir, ps := newGenerationTestStore(t)
+	defer ps.Close()
+	defer os.RemoveAll(dir)
+
+	schema.ParseBytes([]byte("nick:string @index(term)"), 1)
+	for i := uint64(1); i <= 20; i++ {
+		addMutationWithIndex(t, getNew(x.DataKey("nick", i), ps), &taskp.DirectedEdge{
+			Attr: "nick", Entity: i, Value: []byte("rick"),
+		}, Set)
+	}
+
+	require.NoError(t, BeginIndexBuild(context.Background(), "nick", []string{"fulltext"}))
+
+	_, _, ok := BuildStatus("nick")
+	require.True(t, ok, "BuildStatus should see the build as soon as BeginIndexBuild returns")
+
+	require.Eventually(t, func() bool {
+		done, total, ok := BuildStatus("nick")
+		return ok && done == total
+	}, time.Second, time.Millisecond, "backfill should finish in the background without Commit/AbortIndexBuild being called")
+
+	require.NoError(t, CommitIndexBuild(context.Background(), "nick"))
+}
+
+func TestAbortIndexBuildLeavesActiveGenerationUntouched(t *testing.T) {
+	dir, ps := newGenerationTestStore(t)
+	defer ps.Close()
+	defer os.RemoveAll(dir)
+
+	schema.ParseBytes([]byte("nick:string @index(term)"), 1)
+	addMutationWithIndex(t, getNew(x.DataKey("nick", 1), ps), &taskp.DirectedEdge{
+		Attr: "nick", Entity: 1, Value: []byte("rick"),
+	}, Set)
+
+	before := activeIndexKeys(t, "nick")
+
+	require.NoError(t, BeginIndexBuild(context.Background(), "nick", []string{"fulltext"}))
+	require.NoError(t, AbortIndexBuild(context.Background(), "nick"))
+
+	su, ok := schema.State().Get("nick")
+	require.True(t, ok)
+	require.Nil(t, su.Pending)
+	require.Equal(t, []string{"term"}, su.Tokenizer)
+
+	after := activeIndexKeys(t, "nick")
+	require.Equal(t, before, after)
+
+	// A second build attempt should be free to start now that the first
+	// was aborted.
+	require.NoError(t, BeginIndexBuild(context.Background(), "nick", []string{"fulltext"}))
+	require.NoError(t, CommitIndexBuild(context.Background(), "nick"))
+}
@@ -0,0 +1,284 @@
+package posting
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/dgraph-io/dgraph/protos/taskp"
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/types"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// Tokenizer ids for the built-in numeric/date encodings. String
+// analyzers get their id from tokenizerID, keyed by the schema's
+// declared @index(...) name (see analyzer.go). The *_range variants
+// (registered in range.go, which also assigns their ids) carry a
+// prefix-coded multi-precision token set instead of this single
+// full-precision one, so range queries can union a handful of coarse
+// buckets instead of scanning every distinct value.
+const (
+	tokIdDate     = 0x03
+	tokIdDateTime = 0x04
+	tokIdInt      = 0x06
+	tokIdFloat    = 0x07
+)
+
+func init() {
+	tokenizerIDs["int"] = tokIdInt
+	tokenizerIDs["float"] = tokIdFloat
+	tokenizerIDs["date"] = tokIdDate
+	tokenizerIDs["datetime"] = tokIdDateTime
+
+	valueTokenizers["int"] = intTokenizer
+	valueTokenizers["float"] = floatTokenizer
+	valueTokenizers["date"] = dateTokenizer
+	valueTokenizers["datetime"] = dateTimeTokenizer
+}
+
+// valueTokenizerFunc produces the unprefixed token payload(s) a
+// non-string tokenizer emits for sv; IndexTokens prepends the
+// tokenizer's id byte uniformly for every tokenizer, string or not.
+type valueTokenizerFunc func(sv types.Val) ([]string, error)
+
+var valueTokenizers = make(map[string]valueTokenizerFunc)
+
+// IndexTokens returns the set of index tokens sv should be indexed
+// under for attr's active generation: one token set per tokenizer
+// declared in attr's @index(...), each already prefixed with that
+// tokenizer's id byte (and, once attr has been through an online index
+// build, the active generation's marker -- see generation.go) so tokens
+// from different tokenizers, or different generations, on the same attr
+// can't collide.
+func IndexTokens(attr string, sv types.Val) ([]string, error) {
+	su, ok := schema.State().Get(attr)
+	if !ok {
+		return nil, x.Errorf("Schema not defined for attr %q", attr)
+	}
+	if len(su.Tokenizer) == 0 {
+		return nil, x.Errorf("Attr %q is not indexed", attr)
+	}
+
+	toks, err := runTokenizers(su.Tokenizer, sv)
+	if err != nil {
+		return nil, err
+	}
+	return tagGen(su.ActiveGen, toks), nil
+}
+
+// runTokenizers runs every named tokenizer/analyzer in names over sv and
+// concatenates their id-prefixed tokens.
+func runTokenizers(names []string, sv types.Val) ([]string, error) {
+	var out []string
+	for _, name := range names {
+		toks, err := runTokenizer(name, sv)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, toks...)
+	}
+	return out, nil
+}
+
+// runTokenizer produces the id-prefixed tokens a single named
+// tokenizer/analyzer emits for sv. name is resolved against the
+// value-tokenizer registry first (int, float, date, ...), then against
+// the string analyzer registry (term, fulltext, ...) from analyzer.go.
+func runTokenizer(name string, sv types.Val) ([]string, error) {
+	if fn, ok := valueTokenizers[name]; ok {
+		toks, err := fn(sv)
+		if err != nil {
+			return nil, err
+		}
+		return prefixTokens(tokenizerID(name), toks), nil
+	}
+	if fn, ok := getAnalyzer(name); ok {
+		return prefixTokens(tokenizerID(name), fn(string(sv.Value))), nil
+	}
+	return nil, x.Errorf("Unknown tokenizer %q", name)
+}
+
+// prefixTokens prepends id to every token in toks.
+func prefixTokens(id byte, toks []string) []string {
+	if len(toks) == 0 {
+		return nil
+	}
+	prefix := string([]byte{id})
+	out := make([]string, len(toks))
+	for i, t := range toks {
+		out[i] = prefix + t
+	}
+	return out
+}
+
+// intTokenizer encodes a base-10 integer string as a signByte (1 if >=
+// 0, else 0, so negatives sort first) followed by big-endian int32
+// bytes.
+func intTokenizer(sv types.Val) ([]string, error) {
+	val, err := types.ParseInt(sv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{encodeSignedInt32(int32(val))}, nil
+}
+
+// floatTokenizer encodes a float the same way as intTokenizer, after
+// truncating it to an int32 (fractional precision isn't indexed).
+func floatTokenizer(sv types.Val) ([]string, error) {
+	val, err := types.ParseFloat(sv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{encodeSignedInt32(int32(val))}, nil
+}
+
+// dateTokenizer encodes a date's year the same way as intTokenizer.
+func dateTokenizer(sv types.Val) ([]string, error) {
+	t, err := types.ParseDate(sv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{encodeSignedInt32(int32(t.Year()))}, nil
+}
+
+// dateTimeTokenizer encodes a datetime's year the same way as
+// intTokenizer.
+func dateTimeTokenizer(sv types.Val) ([]string, error) {
+	t, err := types.ParseDateTime(sv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{encodeSignedInt32(int32(t.Year()))}, nil
+}
+
+func encodeSignedInt32(val int32) string {
+	buf := make([]byte, 5)
+	if val >= 0 {
+		buf[0] = 1
+	} else {
+		buf[0] = 0
+	}
+	binary.BigEndian.PutUint32(buf[1:], uint32(val))
+	return string(buf)
+}
+
+// AddMutationWithIndex applies edge to l like AddMutation, and also
+// updates every index posting list derived from the attribute's old and
+// new value so queries against the index stay consistent with the data.
+// If attr has an online index build in progress (see generation.go), it
+// also dual-writes the same before/after move to the pending
+// generation, using that build's own tokenizer config, so the build
+// doesn't miss mutations that land while its backfill is still running.
+func (l *List) AddMutationWithIndex(ctx context.Context, edge *taskp.DirectedEdge) error {
+	if len(edge.Attr) == 0 {
+		return x.Errorf("Index mutation with empty attribute")
+	}
+	if _, ok := schema.State().Get(edge.Attr); !ok {
+		return x.Errorf("Schema not defined for attr %q", edge.Attr)
+	}
+
+	l.Lock()
+	var beforeVal []byte
+	hasBefore := false
+	if p := l.singlePostingLocked(); p != nil {
+		beforeVal, hasBefore = p.Value, true
+	}
+
+	updated := l.addMutationLocked(edge)
+	if updated {
+		l.dirty = true
+	}
+	l.Unlock()
+	if !updated {
+		return nil
+	}
+	if err := l.syncIfDirty(); err != nil {
+		return err
+	}
+
+	// Re-read schema state now that the data key's write has landed,
+	// rather than using the snapshot read before it: if BeginIndexBuild
+	// registered a pending generation in the gap, the stale pre-write
+	// snapshot's Pending would still be nil, so this mutation would
+	// apply its data write but skip dual-writing to the new generation
+	// -- and since only a later mutation on the same uid would ever
+	// refresh it, a backfill that scanned this uid in that gap would
+	// permanently miss this mutation's move.
+	su, ok := schema.State().Get(edge.Attr)
+	if !ok {
+		return x.Errorf("Schema not defined for attr %q", edge.Attr)
+	}
+
+	afterVal, hasAfter := edge.Value, edge.Op != taskp.DirectedEdge_DEL
+
+	if len(su.Tokenizer) > 0 {
+		before, err := genTokens(su.Tokenizer, su.ActiveGen, hasBefore, beforeVal)
+		if err != nil {
+			return err
+		}
+		after, err := genTokens(su.Tokenizer, su.ActiveGen, hasAfter, afterVal)
+		if err != nil {
+			return err
+		}
+		if err := updateIndex(ctx, edge.Attr, edge.Entity, before, after); err != nil {
+			return err
+		}
+	}
+
+	if su.Pending != nil {
+		before, err := genTokens(su.Pending.Tokenizer, su.Pending.Gen, hasBefore, beforeVal)
+		if err != nil {
+			return err
+		}
+		after, err := genTokens(su.Pending.Tokenizer, su.Pending.Gen, hasAfter, afterVal)
+		if err != nil {
+			return err
+		}
+		if err := updateIndex(ctx, edge.Attr, edge.Entity, before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateIndex reconciles uid's membership in attr's index posting lists
+// with the move from the before token set to the after one.
+func updateIndex(ctx context.Context, attr string, uid uint64, before, after []string) error {
+	afterSet := make(map[string]bool, len(after))
+	for _, t := range after {
+		afterSet[t] = true
+	}
+	for _, t := range before {
+		if afterSet[t] {
+			continue
+		}
+		pl, _ := GetOrCreate(x.IndexKey(attr, t), 0)
+		if _, err := pl.AddMutation(ctx, &taskp.DirectedEdge{Entity: uid, Op: taskp.DirectedEdge_DEL}); err != nil {
+			return err
+		}
+	}
+
+	beforeSet := make(map[string]bool, len(before))
+	for _, t := range before {
+		beforeSet[t] = true
+	}
+	for _, t := range after {
+		if beforeSet[t] {
+			continue
+		}
+		pl, _ := GetOrCreate(x.IndexKey(attr, t), 0)
+		if _, err := pl.AddMutation(ctx, &taskp.DirectedEdge{Entity: uid, Op: taskp.DirectedEdge_SET}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildIndex regenerates attr's index posting lists in a single pass
+// by one worker goroutine, blocking the caller until it finishes. It's
+// a thin convenience wrapper around
+// RebuildIndexOpts for callers (and tests) that don't need sharded
+// workers, progress reporting or resumability; see rebuild.go.
+func RebuildIndex(ctx context.Context, attr string, tokenizer ...string) error {
+	return RebuildIndexOpts(ctx, attr, RebuildOptions{NumWorkers: 1}, tokenizer...)
+}
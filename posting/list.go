@@ -0,0 +1,236 @@
+// Package posting implements the in-memory, mutable posting lists that
+// back both data and index keys, and the logic to keep index keys in
+// sync with mutations on the data they were derived from.
+package posting
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dgraph-io/dgraph/protos/taskp"
+	"github.com/dgraph-io/dgraph/protos/typesp"
+	"github.com/dgraph-io/dgraph/store"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// Mutation ops, mirroring taskp.DirectedEdge_Op.
+const (
+	Set uint32 = 0x01
+	Del uint32 = 0x02
+)
+
+var (
+	pstore *store.Store
+	syncCh chan *List
+	syncWg sync.WaitGroup
+
+	listsMu sync.RWMutex
+	lists   = make(map[string]*List)
+)
+
+// List is a mutable, in-memory posting list for a single data or index
+// key. Mutations are applied in place and flushed to the store by
+// CommitLists.
+type List struct {
+	sync.RWMutex
+	key   []byte
+	plist *typesp.PostingList
+	dirty bool
+}
+
+// Init wires up the posting package to the given store and starts the
+// background commit worker. It must be called once before any mutation.
+// Calling it again later (as tests do, to get a fresh store) first stops
+// and joins the previous call's worker, so that worker never keeps
+// reading pstore/syncCh concurrently with Init reassigning them.
+func Init(ps *store.Store) {
+	if syncCh != nil {
+		close(syncCh)
+		syncWg.Wait()
+	}
+
+	pstore = ps
+	syncCh = make(chan *List, 10000)
+	listsMu.Lock()
+	lists = make(map[string]*List)
+	listsMu.Unlock()
+
+	syncWg.Add(1)
+	go batchSync(ps, syncCh)
+}
+
+// getNew creates a brand new, empty List for key without consulting the
+// store, discarding whatever was previously cached for it.
+func getNew(key []byte, ps *store.Store) *List {
+	l := &List{key: append([]byte{}, key...), plist: new(typesp.PostingList)}
+	listsMu.Lock()
+	lists[string(key)] = l
+	listsMu.Unlock()
+	return l
+}
+
+// GetOrCreate returns the cached List for key, loading it from the store
+// on first access. The returned bool reports whether it already existed
+// in the cache.
+func GetOrCreate(key []byte, group uint32) (*List, bool) {
+	listsMu.RLock()
+	if l, ok := lists[string(key)]; ok {
+		listsMu.RUnlock()
+		return l, true
+	}
+	listsMu.RUnlock()
+
+	listsMu.Lock()
+	defer listsMu.Unlock()
+	if l, ok := lists[string(key)]; ok {
+		return l, true
+	}
+	l := &List{key: append([]byte{}, key...), plist: new(typesp.PostingList)}
+	if slice, err := pstore.Get(key); err == nil && len(slice.Data()) > 0 {
+		x.Check(l.plist.Unmarshal(slice.Data()))
+	}
+	lists[string(key)] = l
+	return l, false
+}
+
+// addPostingLocked inserts or replaces the posting for uid. It reports
+// whether the list changed.
+func (l *List) addPostingLocked(p *typesp.Posting) bool {
+	for i, old := range l.plist.Postings {
+		if old.Uid == p.Uid {
+			if string(old.Value) == string(p.Value) {
+				return false
+			}
+			l.plist.Postings[i] = p
+			return true
+		}
+	}
+	l.plist.Postings = append(l.plist.Postings, p)
+	return true
+}
+
+// removePostingLocked deletes the posting for uid, if present. It
+// reports whether the list changed.
+func (l *List) removePostingLocked(uid uint64) bool {
+	for i, old := range l.plist.Postings {
+		if old.Uid == uid {
+			l.plist.Postings = append(l.plist.Postings[:i], l.plist.Postings[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// singlePostingLocked returns the first posting in the list, or nil if
+// it's empty. Scalar-valued data keys only ever hold one.
+func (l *List) singlePostingLocked() *typesp.Posting {
+	if len(l.plist.Postings) == 0 {
+		return nil
+	}
+	return l.plist.Postings[0]
+}
+
+// AddMutation applies edge to the list without touching any index. It
+// reports whether the list changed.
+func (l *List) AddMutation(ctx context.Context, edge *taskp.DirectedEdge) (bool, error) {
+	l.Lock()
+	updated := l.addMutationLocked(edge)
+	if updated {
+		l.dirty = true
+	}
+	l.Unlock()
+	if !updated {
+		return false, nil
+	}
+	return true, l.syncIfDirty()
+}
+
+// syncIfDirty writes the list's current contents to the store if it has
+// unflushed changes. Index and data mutations are written through
+// immediately; CommitLists exists as a belt-and-suspenders sweep for
+// anything that didn't get synced on its own mutation path.
+func (l *List) syncIfDirty() error {
+	l.Lock()
+	if !l.dirty {
+		l.Unlock()
+		return nil
+	}
+	data, err := l.plist.Marshal()
+	key := l.key
+	l.dirty = false
+	l.Unlock()
+	if err != nil {
+		return err
+	}
+	return pstore.SetOne(key, data)
+}
+
+func (l *List) addMutationLocked(edge *taskp.DirectedEdge) bool {
+	uid := edge.Entity
+	if edge.ValueId != 0 {
+		uid = edge.ValueId
+	}
+	switch edge.Op {
+	case taskp.DirectedEdge_DEL:
+		return l.removePostingLocked(uid)
+	default:
+		return l.addPostingLocked(&typesp.Posting{Uid: uid, Value: edge.Value, Label: edge.Label})
+	}
+}
+
+// Uids returns the uids of every posting currently in the list.
+func (l *List) Uids() []uint64 {
+	l.RLock()
+	defer l.RUnlock()
+	out := make([]uint64, len(l.plist.Postings))
+	for i, p := range l.plist.Postings {
+		out[i] = p.Uid
+	}
+	return out
+}
+
+// Length returns the number of postings in the list.
+func (l *List) Length() int {
+	l.RLock()
+	defer l.RUnlock()
+	return len(l.plist.Postings)
+}
+
+// CommitLists hands every dirty list to the single background commit
+// worker started by Init, which marshals and writes them to the store.
+// numRoutines is not used.
+func CommitLists(numRoutines int) {
+	listsMu.RLock()
+	all := make([]*List, 0, len(lists))
+	for _, l := range lists {
+		all = append(all, l)
+	}
+	listsMu.RUnlock()
+
+	for _, l := range all {
+		l.Lock()
+		dirty := l.dirty
+		l.dirty = false
+		l.Unlock()
+		if dirty {
+			syncCh <- l
+		}
+	}
+}
+
+// batchSync drains ch, persisting each list it receives to ps, until ch
+// is closed. It takes both as arguments rather than reading the package
+// globals of the same name, so a still-draining call started by a
+// previous Init keeps using its own store and channel undisturbed while
+// a later Init reassigns pstore/syncCh for the next one.
+func batchSync(ps *store.Store, ch chan *List) {
+	defer syncWg.Done()
+	for l := range ch {
+		l.RLock()
+		data, err := l.plist.Marshal()
+		key := l.key
+		l.RUnlock()
+		x.Check(err)
+		x.Check(ps.SetOne(key, data))
+	}
+}
@@ -0,0 +1,42 @@
+package posting
+
+import (
+	"strings"
+
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// TokenizerForFunc picks which of attr's declared tokenizers a query
+// function should resolve its scan against, so a predicate indexed with
+// @index(exact, fulltext) (or @index(int, int_range)) dispatches eq to
+// the exact/int tokenizer, alloftext to fulltext, and ge/gt/le/lt to the
+// *_range tokenizer, rather than scanning whichever happens to be first.
+func TokenizerForFunc(attr, fn string) (string, error) {
+	toks := schema.State().TokenizerNames(attr)
+	if len(toks) == 0 {
+		return "", x.Errorf("Attribute %q is not indexed", attr)
+	}
+
+	for _, name := range toks {
+		if tokenizerMatchesFunc(name, fn) {
+			return name, nil
+		}
+	}
+	// No tokenizer declared a preference for fn; fall back to whichever
+	// was declared first rather than failing the query outright.
+	return toks[0], nil
+}
+
+func tokenizerMatchesFunc(name, fn string) bool {
+	switch fn {
+	case "ge", "gt", "le", "lt":
+		return strings.HasSuffix(name, "_range")
+	case "alloftext":
+		return name == "fulltext"
+	case "eq":
+		return !strings.HasSuffix(name, "_range") && name != "fulltext"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,44 @@
+package posting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/dgraph/schema"
+)
+
+func TestTokenizerForFuncDispatchesByFunc(t *testing.T) {
+	schema.ParseBytes([]byte("name:string @index(exact, fulltext)\nscore:int @index(int, int_range)"), 1)
+
+	name, err := TokenizerForFunc("name", "eq")
+	require.NoError(t, err)
+	require.Equal(t, "exact", name)
+
+	name, err = TokenizerForFunc("name", "alloftext")
+	require.NoError(t, err)
+	require.Equal(t, "fulltext", name)
+
+	name, err = TokenizerForFunc("score", "ge")
+	require.NoError(t, err)
+	require.Equal(t, "int_range", name)
+
+	name, err = TokenizerForFunc("score", "eq")
+	require.NoError(t, err)
+	require.Equal(t, "int", name)
+}
+
+func TestTokenizerForFuncFallsBackToFirstDeclared(t *testing.T) {
+	schema.ParseBytes([]byte("name:string @index(exact, fulltext)"), 1)
+
+	name, err := TokenizerForFunc("name", "unknownfn")
+	require.NoError(t, err)
+	require.Equal(t, "exact", name)
+}
+
+func TestTokenizerForFuncRequiresIndexedAttr(t *testing.T) {
+	schema.ParseBytes([]byte("nonindexed:string"), 1)
+
+	_, err := TokenizerForFunc("nonindexed", "eq")
+	require.Error(t, err)
+}
@@ -0,0 +1,240 @@
+package posting
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/dgraph-io/dgraph/types"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// rangeStep is the number of bits peeled off between successive
+// precision levels of a prefix-coded range token. Lower means more,
+// smaller buckets (finer-grained range scans); 4 mirrors the default
+// Lucene/bleve numeric trie precisionStep.
+const rangeStep = 4
+
+// Tokenizer ids for the prefix-coded range tokenizers.
+const (
+	tokIdIntRange      = 0x0b
+	tokIdFloatRange    = 0x0c
+	tokIdDateRange     = 0x0d
+	tokIdDateTimeRange = 0x0e
+)
+
+func init() {
+	valueTokenizers["int_range"] = intRangeTokenizer
+	valueTokenizers["float_range"] = floatRangeTokenizer
+	valueTokenizers["date_range"] = dateRangeTokenizer
+	valueTokenizers["datetime_range"] = dateTimeRangeTokenizer
+
+	tokenizerIDs["int_range"] = tokIdIntRange
+	tokenizerIDs["float_range"] = tokIdFloatRange
+	tokenizerIDs["date_range"] = tokIdDateRange
+	tokenizerIDs["datetime_range"] = tokIdDateTimeRange
+
+	// takenTokenizerIDs was seeded before these ids were added to
+	// tokenizerIDs, so reserve them here as well.
+	for _, id := range []byte{tokIdIntRange, tokIdFloatRange, tokIdDateRange, tokIdDateTimeRange} {
+		takenTokenizerIDs[id] = true
+	}
+}
+
+// sortableInt64 maps val onto a uint64 keyspace that preserves its
+// signed ordering under an unsigned big-endian byte comparison, by
+// flipping the sign bit.
+func sortableInt64(val int64) uint64 {
+	return uint64(val) ^ (1 << 63)
+}
+
+// sortableFloat64 does the same for float64: flip every bit for
+// negative values (so more-negative sorts first), or just the sign bit
+// for non-negative ones.
+func sortableFloat64(val float64) uint64 {
+	bits := math.Float64bits(val)
+	if bits&(1<<63) != 0 {
+		return ^bits
+	}
+	return bits | (1 << 63)
+}
+
+// intRangeTokenizer emits the prefix-coded multi-precision token set
+// for a base-10 integer string, letting a range query union a handful
+// of coarse buckets instead of scanning every distinct value.
+func intRangeTokenizer(sv types.Val) ([]string, error) {
+	val, err := types.ParseInt(sv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return prefixCodedTokens(sortableInt64(val)), nil
+}
+
+// floatRangeTokenizer is intRangeTokenizer's float64 counterpart.
+func floatRangeTokenizer(sv types.Val) ([]string, error) {
+	val, err := types.ParseFloat(sv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return prefixCodedTokens(sortableFloat64(val)), nil
+}
+
+// dateRangeTokenizer encodes a date's full unix-nanosecond instant,
+// unlike the year-only "date" tokenizer.
+func dateRangeTokenizer(sv types.Val) ([]string, error) {
+	t, err := types.ParseDate(sv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return prefixCodedTokens(sortableInt64(t.UnixNano())), nil
+}
+
+// dateTimeRangeTokenizer is dateRangeTokenizer's datetime counterpart.
+func dateTimeRangeTokenizer(sv types.Val) ([]string, error) {
+	t, err := types.ParseDateTime(sv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return prefixCodedTokens(sortableInt64(t.UnixNano())), nil
+}
+
+// prefixCodedTokens returns one token per precision level (0, rangeStep,
+// 2*rangeStep, ..., 64-rangeStep), each the big-endian bytes of
+// sortable right-shifted by that many bits, tagged with the shift
+// amount so levels can't collide with one another.
+func prefixCodedTokens(sortable uint64) []string {
+	out := make([]string, 0, 64/rangeStep)
+	for shift := uint(0); shift < 64; shift += rangeStep {
+		out = append(out, encodePrefixCoded(shift, sortable>>shift))
+	}
+	return out
+}
+
+// encodePrefixCoded packs shift and the (64-shift) meaningful bits of
+// bucket into a token: a one-byte shift marker followed by just enough
+// big-endian bytes to hold what's left after the shift.
+func encodePrefixCoded(shift uint, bucket uint64) string {
+	nbytes := (64 - int(shift) + 7) / 8
+	var full [8]byte
+	binary.BigEndian.PutUint64(full[:], bucket)
+	buf := make([]byte, 1+nbytes)
+	buf[0] = byte(shift)
+	copy(buf[1:], full[8-nbytes:])
+	return string(buf)
+}
+
+// RangeTokens returns the minimal set of prefix-coded tokens (already
+// id-prefixed for tokenizerName) whose postings, unioned, are exactly
+// the set of values in [lo, hi] that tokenizerName indexed -- a query
+// layer's range scan should union these instead of walking every
+// distinct indexed value between lo and hi.
+func RangeTokens(tokenizerName string, lo, hi types.Val) ([]string, error) {
+	loSortable, err := sortableValueFor(tokenizerName, lo)
+	if err != nil {
+		return nil, err
+	}
+	hiSortable, err := sortableValueFor(tokenizerName, hi)
+	if err != nil {
+		return nil, err
+	}
+	if loSortable > hiSortable {
+		return nil, x.Errorf("RangeTokens: lo > hi")
+	}
+
+	id := tokenizerID(tokenizerName)
+	prefix := string([]byte{id})
+	var out []string
+	for _, bucket := range decomposeRange(loSortable, hiSortable, 64-rangeStep) {
+		out = append(out, prefix+bucket)
+	}
+	return out, nil
+}
+
+// sortableValueFor converts sv into the sortable uint64 keyspace the
+// named range tokenizer indexes into.
+func sortableValueFor(tokenizerName string, sv types.Val) (uint64, error) {
+	switch tokenizerName {
+	case "int_range":
+		val, err := types.ParseInt(sv.Value)
+		if err != nil {
+			return 0, err
+		}
+		return sortableInt64(val), nil
+	case "float_range":
+		val, err := types.ParseFloat(sv.Value)
+		if err != nil {
+			return 0, err
+		}
+		return sortableFloat64(val), nil
+	case "date_range":
+		t, err := types.ParseDate(sv.Value)
+		if err != nil {
+			return 0, err
+		}
+		return sortableInt64(t.UnixNano()), nil
+	case "datetime_range":
+		t, err := types.ParseDateTime(sv.Value)
+		if err != nil {
+			return 0, err
+		}
+		return sortableInt64(t.UnixNano()), nil
+	default:
+		return 0, x.Errorf("%q is not a range tokenizer", tokenizerName)
+	}
+}
+
+// decomposeRange covers [lo, hi] with the fewest prefix-coded buckets
+// at or below shift. It's called starting from the coarsest shift, so
+// whenever lo and hi fall in the same bucket at a level, that single
+// bucket (refined further only if it's not fully covered) is enough;
+// otherwise the misaligned slivers at either end are peeled off to the
+// next finer shift and whatever fully-covered buckets remain in between
+// are emitted directly at the current shift.
+func decomposeRange(lo, hi uint64, shift uint) []string {
+	if lo > hi {
+		return nil
+	}
+	if shift == 0 {
+		out := make([]string, 0, hi-lo+1)
+		for v := lo; ; v++ {
+			out = append(out, encodePrefixCoded(0, v))
+			if v == hi {
+				break
+			}
+		}
+		return out
+	}
+
+	size := uint64(1) << shift
+	mask := size - 1
+	loBucket, hiBucket := lo>>shift, hi>>shift
+
+	if loBucket == hiBucket {
+		if lo&mask == 0 && hi&mask == mask {
+			return []string{encodePrefixCoded(shift, loBucket)}
+		}
+		return decomposeRange(lo, hi, shift-rangeStep)
+	}
+
+	var out []string
+	if lo&mask != 0 {
+		headHi := lo | mask
+		out = append(out, decomposeRange(lo, headHi, shift-rangeStep)...)
+		lo = headHi + 1
+		loBucket = lo >> shift
+	}
+	if hi&mask != mask {
+		tailLo := hi &^ mask
+		out = append(out, decomposeRange(tailLo, hi, shift-rangeStep)...)
+		hi = tailLo - 1
+		hiBucket = hi >> shift
+	}
+	if lo <= hi {
+		for b := loBucket; ; b++ {
+			out = append(out, encodePrefixCoded(shift, b))
+			if b == hiBucket {
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package posting
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/types"
+)
+
+func TestIndexingIntRange(t *testing.T) {
+	schema.ParseBytes([]byte("age:int @index(int_range)"), 1)
+	a, err := IndexTokens("age", types.Val{Tid: types.StringID, Value: []byte("10")})
+	require.NoError(t, err)
+	require.Len(t, a, 16)
+
+	// The finest-precision token comes first: shift 0, every bit of the
+	// sortable value, so it's stable and distinct per value.
+	require.EqualValues(t, tokIdIntRange, a[0][0])
+	require.EqualValues(t, 0, a[0][1])
+
+	// The coarsest bucket comes last, carrying only the top 4 bits.
+	coarse := a[len(a)-1]
+	require.EqualValues(t, tokIdIntRange, coarse[0])
+	require.EqualValues(t, 60, coarse[1])
+}
+
+func TestIndexingFloatRange(t *testing.T) {
+	schema.ParseBytes([]byte("price:float @index(float_range)"), 1)
+	a, err := IndexTokens("price", types.Val{Tid: types.StringID, Value: []byte("10.43")})
+	require.NoError(t, err)
+	require.Len(t, a, 16)
+	require.EqualValues(t, tokIdFloatRange, a[0][0])
+}
+
+// bruteForceRange returns every integer in [lo, hi] encoded as a
+// full-precision (shift 0) token, for comparing against decomposeRange.
+func bruteForceRange(lo, hi uint64) map[string]bool {
+	out := make(map[string]bool)
+	for v := lo; ; v++ {
+		out[encodePrefixCoded(0, v)] = true
+		if v == hi {
+			break
+		}
+	}
+	return out
+}
+
+// expandBucket returns every shift-0 token covered by a bucket at shift.
+func expandBucket(shift uint, bucket uint64) map[string]bool {
+	out := make(map[string]bool)
+	size := uint64(1) << shift
+	base := bucket << shift
+	for i := uint64(0); i < size; i++ {
+		out[encodePrefixCoded(0, base+i)] = true
+	}
+	return out
+}
+
+func TestDecomposeRangeAgainstBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		lo := uint64(rnd.Intn(1 << 12))
+		hi := lo + uint64(rnd.Intn(1<<12))
+
+		buckets := decomposeRange(lo, hi, 64-rangeStep)
+
+		got := make(map[string]bool)
+		for _, b := range buckets {
+			shift := uint(b[0])
+			var full [8]byte
+			copy(full[8-len(b)+1:], b[1:])
+			value := uint64(0)
+			for _, c := range full {
+				value = value<<8 | uint64(c)
+			}
+			for k := range expandBucket(shift, value) {
+				got[k] = true
+			}
+		}
+
+		want := bruteForceRange(lo, hi)
+		require.Equal(t, len(want), len(got), "lo=%d hi=%d", lo, hi)
+		for k := range want {
+			require.True(t, got[k], "missing token for lo=%d hi=%d", lo, hi)
+		}
+	}
+}
+
+func TestRangeTokens(t *testing.T) {
+	schema.ParseBytes([]byte("age:int @index(int_range)"), 1)
+	toks, err := RangeTokens("int_range",
+		types.Val{Tid: types.StringID, Value: []byte("5")},
+		types.Val{Tid: types.StringID, Value: []byte("5")})
+	require.NoError(t, err)
+	require.NotEmpty(t, toks)
+	for _, tk := range toks {
+		require.EqualValues(t, tokIdIntRange, tk[0])
+	}
+
+	_, err = RangeTokens("int_range",
+		types.Val{Tid: types.StringID, Value: []byte("5")},
+		types.Val{Tid: types.StringID, Value: []byte("1")})
+	require.Error(t, err)
+}
@@ -0,0 +1,397 @@
+package posting
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// RebuildOptions controls how RebuildIndexOpts paces a rebuild.
+type RebuildOptions struct {
+	// NumWorkers is the number of goroutines rebuilding disjoint uid
+	// ranges concurrently. Defaults to 1.
+	//
+	// Shard boundaries are derived from NumWorkers, so a Resume call
+	// must pass the same NumWorkers the interrupted call used; the
+	// rebuild refuses to proceed otherwise.
+	NumWorkers int
+	// BatchSize is how many uids a worker processes between persisting
+	// its shard's progress marker. Defaults to 1000.
+	BatchSize int
+	// Resume, if true, skips dropping the existing index entries and
+	// has each shard pick up from its last persisted progress marker
+	// instead of starting over from the beginning of its range.
+	Resume bool
+	// ProgressFn, if set, is called after every batch with the number
+	// of uids processed so far and the total uids in scope, so callers
+	// can report an ETA.
+	ProgressFn func(done, total uint64)
+}
+
+func (o RebuildOptions) withDefaults() RebuildOptions {
+	if o.NumWorkers <= 0 {
+		o.NumWorkers = 1
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 1000
+	}
+	return o
+}
+
+// rebuildState tracks the live progress of one attr/generation's
+// in-flight (or most recently finished) rebuild, so RebuildStatus and
+// BuildStatus can answer without the caller having to thread a channel
+// through.
+type rebuildState struct {
+	done  uint64 // atomic
+	total uint64 // atomic
+}
+
+// rebuildKey identifies one attr's rebuild of one generation, so an
+// active-generation rebuild (RebuildIndexOpts) and a pending-generation
+// backfill (BeginIndexBuild) on the same attr never share progress
+// state.
+type rebuildKey struct {
+	attr string
+	gen  byte
+}
+
+var (
+	rebuildsMu sync.RWMutex
+	rebuilds   = make(map[rebuildKey]*rebuildState)
+)
+
+// RebuildStatus reports the done/total uid counts for attr's most
+// recently started rebuild of its active generation. ok is false if no
+// such rebuild has ever run. The counts keep reflecting the last run's
+// final tally after it finishes, until a new rebuild for the same attr
+// begins; across a cancel-then-resume pair, done accumulates the uids
+// processed by both calls, not just the most recent one.
+func RebuildStatus(attr string) (done, total uint64, ok bool) {
+	su, ok := schema.State().Get(attr)
+	if !ok {
+		return 0, 0, false
+	}
+	return genRebuildStatus(attr, su.ActiveGen)
+}
+
+// genRebuildStatus reports the done/total uid counts for attr's most
+// recently started rebuild of generation gen.
+func genRebuildStatus(attr string, gen byte) (done, total uint64, ok bool) {
+	rebuildsMu.RLock()
+	rs, ok := rebuilds[rebuildKey{attr, gen}]
+	rebuildsMu.RUnlock()
+	if !ok {
+		return 0, 0, false
+	}
+	return atomic.LoadUint64(&rs.done), atomic.LoadUint64(&rs.total), true
+}
+
+// RebuildIndexOpts regenerates attr's index posting lists, as RebuildIndex
+// does, but shards attr's uid-space across opts.NumWorkers goroutines and
+// supports resuming an interrupted run. With no tokenizer argument, every
+// compound index declared in attr's @index(...) is rebuilt; passing one
+// or more tokenizer names scopes the rebuild to just those.
+//
+// Each shard persists the last uid it fully processed, and how many
+// uids it had processed as of that checkpoint, under a reserved progress
+// key (see x.RebuildProgressKey). With opts.Resume set, existing index
+// entries are left in place and every shard resumes from its own marker
+// rather than from the start of its range, and RebuildStatus's done
+// count picks up from the persisted checkpoints instead of restarting at
+// zero; without it, the targeted index entries are dropped up front and
+// every shard starts from scratch, matching RebuildIndex's existing
+// one-shot behaviour. Resume also requires opts.NumWorkers to match the
+// interrupted call, since the shard boundaries a different worker count
+// would compute don't line up with the old progress markers.
+//
+// ctx cancellation is honoured between uids: RebuildIndexOpts returns
+// ctx.Err() as soon as it notices, leaving each shard's progress marker
+// at its last persisted checkpoint (written every opts.BatchSize uids),
+// so a later call with opts.Resume set picks up from there; uids
+// processed after that checkpoint are processed again.
+func RebuildIndexOpts(ctx context.Context, attr string, opts RebuildOptions, tokenizer ...string) error {
+	su, ok := schema.State().Get(attr)
+	if !ok {
+		return x.Errorf("Schema not defined for attr %q", attr)
+	}
+	names := su.Tokenizer
+	if len(tokenizer) > 0 {
+		names = tokenizer
+	}
+	return rebuildGen(ctx, attr, names, su.ActiveGen, len(tokenizer) == 0, opts)
+}
+
+// rebuildGen is the sharded, resumable engine shared by RebuildIndexOpts
+// (rebuilding attr's active generation) and BeginIndexBuild's backfill
+// (populating attr's pending generation). names is the set of
+// tokenizers to run; blanketDrop, when not resuming, drops gen's whole
+// index prefix instead of scoping the drop to names' tokenizer ids --
+// RebuildIndexOpts sets it when the caller didn't name specific
+// tokenizers, so stray entries from a stale tokenizer config get wiped
+// too.
+func rebuildGen(ctx context.Context, attr string, names []string, gen byte, blanketDrop bool, opts RebuildOptions) error {
+	opts = opts.withDefaults()
+
+	pk := x.ParsedKey{Attr: attr}
+	shardCountKey := x.RebuildShardCountKey(attr, gen)
+	if opts.Resume {
+		if want, ok, err := readCounter(shardCountKey); err != nil {
+			return err
+		} else if ok && want != uint64(opts.NumWorkers) {
+			return x.Errorf(
+				"Resume requires the same NumWorkers as the interrupted rebuild of attr %q: got %d, want %d",
+				attr, opts.NumWorkers, want)
+		}
+	} else {
+		if blanketDrop {
+			if err := dropPrefix(genIndexPrefix(pk, gen)); err != nil {
+				return err
+			}
+		} else {
+			for _, name := range names {
+				if err := dropPrefix(genTokenizerPrefix(pk, gen, tokenizerID(name))); err != nil {
+					return err
+				}
+			}
+		}
+		if err := writeCounter(shardCountKey, uint64(opts.NumWorkers)); err != nil {
+			return err
+		}
+	}
+
+	minUid, maxUid, total, err := uidBounds(pk.DataPrefix())
+	if err != nil {
+		return err
+	}
+
+	rs := &rebuildState{total: total}
+	if opts.Resume {
+		// Recover attr's cumulative progress from before the
+		// interruption, so RebuildStatus doesn't regress to only
+		// counting uids processed by this resumed call.
+		for w := 0; w < opts.NumWorkers; w++ {
+			if _, count, ok, err := readProgress(x.RebuildProgressKey(attr, gen, uint32(w))); err != nil {
+				return err
+			} else if ok {
+				rs.done += count
+			}
+		}
+	}
+	rebuildsMu.Lock()
+	rebuilds[rebuildKey{attr, gen}] = rs
+	rebuildsMu.Unlock()
+
+	if total == 0 {
+		return nil
+	}
+
+	shardWidth := (maxUid - minUid) / uint64(opts.NumWorkers)
+	if shardWidth == 0 || (maxUid-minUid)%uint64(opts.NumWorkers) != 0 {
+		shardWidth++
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for w := 0; w < opts.NumWorkers; w++ {
+		start := minUid + uint64(w)*shardWidth
+		if start > maxUid {
+			break
+		}
+		end := start + shardWidth // exclusive
+		if end > maxUid+1 || w == opts.NumWorkers-1 {
+			end = maxUid + 1
+		}
+
+		wg.Add(1)
+		go func(shard uint32, start, end uint64) {
+			defer wg.Done()
+			if err := rebuildShard(ctx, attr, names, gen, shard, start, end, opts, rs); err != nil {
+				errOnce.Do(func() { firstErr = err })
+			}
+		}(uint32(w), start, end)
+	}
+	wg.Wait()
+	if firstErr == nil {
+		if err := pstore.Delete(shardCountKey); err != nil {
+			return err
+		}
+		for w := 0; w < opts.NumWorkers; w++ {
+			if err := pstore.Delete(x.RebuildProgressKey(attr, gen, uint32(w))); err != nil {
+				return err
+			}
+		}
+	}
+	return firstErr
+}
+
+// rebuildShard rebuilds attr's generation-gen index entries for every
+// uid in [start, end), resuming from shard's persisted progress marker
+// when opts.Resume is set.
+func rebuildShard(ctx context.Context, attr string, names []string, gen byte, shard uint32,
+	start, end uint64, opts RebuildOptions, rs *rebuildState) error {
+
+	progressKey := x.RebuildProgressKey(attr, gen, shard)
+	var shardDone uint64
+	if opts.Resume {
+		if last, count, ok, err := readProgress(progressKey); err != nil {
+			return err
+		} else if ok {
+			shardDone = count
+			if last+1 > start {
+				start = last + 1
+			}
+		}
+	}
+	if start >= end {
+		return nil
+	}
+
+	it := pstore.NewIterator()
+	defer it.Close()
+
+	processed := 0
+	for it.Seek(x.DataKey(attr, start)); it.Valid(); it.Next() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		parsed := x.Parse(it.Key().Data())
+		if !parsed.IsData() || parsed.Attr != attr || parsed.Uid >= end {
+			break
+		}
+
+		l, _ := GetOrCreate(append([]byte{}, it.Key().Data()...), 0)
+		l.RLock()
+		p := l.singlePostingLocked()
+		l.RUnlock()
+		if p != nil {
+			toks, err := genTokens(names, gen, true, p.Value)
+			if err != nil {
+				return err
+			}
+			if err := updateIndex(ctx, attr, parsed.Uid, nil, toks); err != nil {
+				return err
+			}
+		}
+
+		atomic.AddUint64(&rs.done, 1)
+		shardDone++
+		processed++
+		if processed >= opts.BatchSize {
+			if err := writeProgress(progressKey, parsed.Uid, shardDone); err != nil {
+				return err
+			}
+			processed = 0
+			if opts.ProgressFn != nil {
+				opts.ProgressFn(atomic.LoadUint64(&rs.done), atomic.LoadUint64(&rs.total))
+			}
+		}
+	}
+
+	// Persist a marker covering the shard's whole range instead of
+	// deleting progressKey, so a resume triggered by *other* shards
+	// having been interrupted (NumWorkers > 1) still counts this
+	// shard's uids into rs.done and skips rescanning it -- rebuildGen
+	// clears every shard's marker once the whole rebuild finishes
+	// cleanly.
+	if err := writeProgress(progressKey, end-1, shardDone); err != nil {
+		return err
+	}
+	if opts.ProgressFn != nil {
+		opts.ProgressFn(atomic.LoadUint64(&rs.done), atomic.LoadUint64(&rs.total))
+	}
+	return nil
+}
+
+// uidBounds scans the data keys under dataPrefix once to find the
+// smallest and largest uid present and how many there are, so
+// rebuildGen can divide the range into fixed-size shards up front.
+func uidBounds(dataPrefix []byte) (min, max, total uint64, err error) {
+	it := pstore.NewIterator()
+	defer it.Close()
+
+	first := true
+	for it.Seek(dataPrefix); it.ValidForPrefix(dataPrefix); it.Next() {
+		uid := x.Parse(it.Key().Data()).Uid
+		if first {
+			min, max = uid, uid
+			first = false
+		} else {
+			if uid < min {
+				min = uid
+			}
+			if uid > max {
+				max = uid
+			}
+		}
+		total++
+	}
+	return min, max, total, nil
+}
+
+// readProgress returns the last uid progressKey's shard fully processed
+// as of its last persisted checkpoint, and the cumulative count of uids
+// it had processed by then.
+func readProgress(progressKey []byte) (uid, count uint64, ok bool, err error) {
+	slice, err := pstore.Get(progressKey)
+	if err != nil || len(slice.Data()) < 16 {
+		return 0, 0, false, nil
+	}
+	data := slice.Data()
+	return binary.BigEndian.Uint64(data[0:8]), binary.BigEndian.Uint64(data[8:16]), true, nil
+}
+
+// writeProgress persists uid as the last uid progressKey's shard has
+// fully processed, alongside count, its cumulative processed-uid total
+// so far, so a later resume can recover RebuildStatus's running count.
+func writeProgress(progressKey []byte, uid, count uint64) error {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[0:8], uid)
+	binary.BigEndian.PutUint64(buf[8:16], count)
+	return pstore.SetOne(progressKey, buf)
+}
+
+// readCounter returns the uint64 persisted under key by writeCounter.
+func readCounter(key []byte) (val uint64, ok bool, err error) {
+	slice, err := pstore.Get(key)
+	if err != nil || len(slice.Data()) < 8 {
+		return 0, false, nil
+	}
+	return binary.BigEndian.Uint64(slice.Data()), true, nil
+}
+
+// writeCounter persists val under key.
+func writeCounter(key []byte, val uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, val)
+	return pstore.SetOne(key, buf)
+}
+
+// dropPrefix deletes every key under prefix in pstore.
+func dropPrefix(prefix []byte) error {
+	it := pstore.NewIterator()
+	defer it.Close()
+	var keys [][]byte
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		keys = append(keys, append([]byte{}, it.Key().Data()...))
+	}
+	for _, k := range keys {
+		if err := pstore.Delete(k); err != nil {
+			return err
+		}
+		listsMu.Lock()
+		delete(lists, string(k))
+		listsMu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package posting
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/store"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+const rebuildSchemaStr = `
+name:string @index
+`
+
+// populateNames writes n "name" edges (uids 1..n) directly, bypassing
+// indexing, so RebuildIndexOpts has something to index from scratch.
+func populateNames(t *testing.T, n int) (string, *store.Store) {
+	dir, err := ioutil.TempDir("", "storetest_")
+	require.NoError(t, err)
+
+	ps, err := store.NewStore(dir)
+	require.NoError(t, err)
+
+	schema.ParseBytes([]byte(rebuildSchemaStr), 1)
+	Init(ps)
+
+	for i := 1; i <= n; i++ {
+		addEdgeToValue(t, ps, "name", uint64(i), fmt.Sprintf("name%d", i))
+	}
+	CommitLists(10)
+	for len(syncCh) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return dir, ps
+}
+
+// nameIndexEntries snapshots every index posting list for "name" as a map
+// from index key to its sorted set of uids, for comparing two rebuilds.
+func nameIndexEntries(t *testing.T, ps *store.Store) map[string][]uint64 {
+	it := ps.NewIterator()
+	defer it.Close()
+
+	pk := x.ParsedKey{Attr: "name"}
+	prefix := pk.IndexPrefix()
+	out := make(map[string][]uint64)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		l, _ := GetOrCreate(append([]byte{}, it.Key().Data()...), 0)
+		out[string(it.Key().Data())] = l.Uids()
+	}
+	return out
+}
+
+func TestRebuildIndexOptsCancelAndResume(t *testing.T) {
+	const n = 30
+	dir, ps := populateNames(t, n)
+	defer ps.Close()
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := RebuildOptions{
+		NumWorkers: 1,
+		BatchSize:  5,
+		ProgressFn: func(done, total uint64) {
+			if done >= 10 {
+				cancel()
+			}
+		},
+	}
+	err := RebuildIndexOpts(ctx, "name", opts)
+	require.Error(t, err)
+
+	done, total, ok := RebuildStatus("name")
+	require.True(t, ok)
+	require.EqualValues(t, n, total)
+	require.True(t, done < uint64(n), "rebuild should have been interrupted before finishing")
+
+	// Resuming should finish the job without redoing work that would
+	// produce duplicate or inconsistent entries.
+	resumeOpts := RebuildOptions{NumWorkers: 1, BatchSize: 5, Resume: true}
+	require.NoError(t, RebuildIndexOpts(context.Background(), "name", resumeOpts))
+	CommitLists(10)
+	for len(syncCh) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resumed := nameIndexEntries(t, ps)
+
+	// The resumed rebuild should land on exactly the same index a
+	// one-shot, never-interrupted rebuild would have produced: one
+	// entry per distinct name, each holding just its own uid.
+	require.Len(t, resumed, n)
+	for i := 1; i <= n; i++ {
+		key := x.IndexKey("name", fmt.Sprintf("\x01name%d", i))
+		require.ElementsMatch(t, []uint64{uint64(i)}, resumed[string(key)])
+	}
+
+	// RebuildStatus should report the whole logical rebuild as done, not
+	// just the uids the resumed call itself processed.
+	done, total, ok = RebuildStatus("name")
+	require.True(t, ok)
+	require.EqualValues(t, n, total)
+	require.EqualValues(t, n, done)
+}
+
+// TestRebuildIndexOptsResumeRequiresSameNumWorkers guards against a
+// resumed rebuild silently skipping uids when it's handed a different
+// NumWorkers than the interrupted run: shard boundaries are derived from
+// NumWorkers, so shard N's old progress marker wouldn't correspond to
+// shard N's new range.
+func TestRebuildIndexOptsResumeRequiresSameNumWorkers(t *testing.T) {
+	const n = 100
+	dir, ps := populateNames(t, n)
+	defer ps.Close()
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := RebuildOptions{
+		NumWorkers: 2,
+		BatchSize:  5,
+		ProgressFn: func(done, total uint64) {
+			if done >= 20 {
+				cancel()
+			}
+		},
+	}
+	require.Error(t, RebuildIndexOpts(ctx, "name", opts))
+
+	resumeOpts := RebuildOptions{NumWorkers: 4, BatchSize: 5, Resume: true}
+	err := RebuildIndexOpts(context.Background(), "name", resumeOpts)
+	require.Error(t, err, "resuming with a different NumWorkers must be rejected, not silently skip uids")
+}
+
+// TestRebuildShardPersistsMarkerOnCleanCompletion guards against a shard
+// that finished cleanly having its progress key deleted outright: with
+// NumWorkers > 1, a later Resume triggered by *other* shards being
+// interrupted must still see this shard as done, both to avoid
+// undercounting its uids in RebuildStatus and to avoid needlessly
+// rescanning it.
+func TestRebuildShardPersistsMarkerOnCleanCompletion(t *testing.T) {
+	const n = 20
+	dir, ps := populateNames(t, n)
+	defer ps.Close()
+	defer os.RemoveAll(dir)
+
+	opts := RebuildOptions{NumWorkers: 2, BatchSize: 5}
+	rs := &rebuildState{total: n}
+	start, end := uint64(1), uint64(n+1)
+
+	require.NoError(t, rebuildShard(context.Background(), "name", []string{"term"}, 0, 0, start, end, opts, rs))
+
+	progressKey := x.RebuildProgressKey("name", 0, 0)
+	last, count, ok, err := readProgress(progressKey)
+	require.NoError(t, err)
+	require.True(t, ok, "a cleanly finished shard should leave a marker behind, not delete its progress key")
+	require.EqualValues(t, end-1, last)
+	require.EqualValues(t, n, count)
+
+	// A resumed call for the same shard should see it as already done
+	// and skip rescanning it entirely.
+	before := atomic.LoadUint64(&rs.done)
+	resumeOpts := opts
+	resumeOpts.Resume = true
+	require.NoError(t, rebuildShard(context.Background(), "name", []string{"term"}, 0, 0, start, end, resumeOpts, rs))
+	require.Equal(t, before, atomic.LoadUint64(&rs.done), "a shard already marked done should not be rescanned")
+}
+
+// TestRebuildIndexOptsResumeDoesNotUndercountFinishedShard reproduces
+// the NumWorkers > 1 case the single-worker-only
+// TestRebuildIndexOptsCancelAndResume can't exercise: one shard
+// finishes cleanly while another is still interrupted, and a later
+// Resume must still count the finished shard's uids instead of only
+// the interrupted one's.
+func TestRebuildIndexOptsResumeDoesNotUndercountFinishedShard(t *testing.T) {
+	const n = 30
+	dir, ps := populateNames(t, n)
+	defer ps.Close()
+	defer os.RemoveAll(dir)
+
+	opts := RebuildOptions{NumWorkers: 2, BatchSize: 5}
+	rs := &rebuildState{total: n}
+
+	// Shard 0 (uids 1-15) finishes cleanly on its own.
+	require.NoError(t, rebuildShard(context.Background(), "name", []string{"term"}, 0, 0, 1, 16, opts, rs))
+
+	// Shard 1 (uids 16-30) gets interrupted partway through.
+	ctx, cancel := context.WithCancel(context.Background())
+	interruptedOpts := opts
+	interruptedOpts.ProgressFn = func(done, total uint64) {
+		if done >= 20 {
+			cancel()
+		}
+	}
+	require.Error(t, rebuildShard(ctx, "name", []string{"term"}, 0, 1, 16, 31, interruptedOpts, rs))
+
+	// Resuming the whole rebuild must recover shard 0's already-done
+	// uids, not just pick up where shard 1 left off.
+	resumeOpts := RebuildOptions{NumWorkers: 2, BatchSize: 5, Resume: true}
+	require.NoError(t, RebuildIndexOpts(context.Background(), "name", resumeOpts))
+
+	done, total, ok := RebuildStatus("name")
+	require.True(t, ok)
+	require.EqualValues(t, n, total)
+	require.EqualValues(t, n, done, "shard 0's uids must still be counted after resume, not undercounted")
+}
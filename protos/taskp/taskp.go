@@ -0,0 +1,27 @@
+// Package taskp holds the wire structs shared between query processing
+// workers. In the real system these are generated from task.proto; here
+// they're hand-written with the same field names and semantics.
+package taskp
+
+// DirectedEdge_Op enumerates the mutation operations that can be applied
+// to a posting list.
+type DirectedEdge_Op int32
+
+const (
+	DirectedEdge_SET DirectedEdge_Op = 0
+	DirectedEdge_DEL DirectedEdge_Op = 1
+)
+
+// DirectedEdge represents a single mutation: an edge from Entity to
+// either ValueId (for uid-valued predicates) or Value (for scalars).
+type DirectedEdge struct {
+	Entity    uint64
+	Attr      string
+	Value     []byte
+	ValueType uint32
+	ValueId   uint64
+	Label     string
+	Lang      string
+	Op        DirectedEdge_Op
+	Facets    []byte
+}
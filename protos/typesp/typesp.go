@@ -0,0 +1,47 @@
+// Package typesp holds the wire structs for posting lists. In the real
+// system these are generated from types.proto; here they're hand-written
+// with the same field names and a simple gob-based wire format standing
+// in for the generated protobuf codec.
+package typesp
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Posting is a single entry in a PostingList: either a uid-edge or a
+// scalar value attached to the owning entity.
+type Posting struct {
+	Uid       uint64
+	Value     []byte
+	ValueType uint32
+	Label     string
+	Lang      string
+	Facets    []byte
+	Op        uint32
+	Commit    uint64
+}
+
+// PostingList is the on-disk representation of a posting list: the set
+// of postings for one (attr, uid) data key or one (attr, term) index key.
+type PostingList struct {
+	Postings []*Posting
+	Commit   uint64
+}
+
+// Marshal serializes the PostingList for storage.
+func (pl *PostingList) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(pl); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal deserializes data produced by Marshal into pl.
+func (pl *PostingList) Unmarshal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(pl)
+}
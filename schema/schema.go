@@ -0,0 +1,234 @@
+// Package schema tracks the predicate schema for the group(s) this
+// instance serves: each predicate's value type, and the tokenizers (if
+// any) it should be indexed with.
+package schema
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/dgraph/types"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// Update describes the schema for a single predicate.
+type Update struct {
+	Predicate string
+	ValueType types.TypeID
+	Tokenizer []string
+	Group     uint32
+
+	// ActiveGen is which of the predicate's two index generations (0 or
+	// 1) mutations and queries currently treat as live. It only ever
+	// moves by way of CommitBuild, promoting the generation a
+	// BeginBuild/CommitBuild round populated in the background.
+	ActiveGen byte
+	// Pending describes an index build in progress, if any: while it's
+	// non-nil, mutations dual-write to both the active and the pending
+	// generation, using each generation's own tokenizer config.
+	Pending *PendingBuild
+}
+
+// PendingBuild describes an in-flight online index build for a
+// predicate: the tokenizer config being populated into the inactive
+// generation, and that generation's id.
+type PendingBuild struct {
+	Tokenizer []string
+	Gen       byte
+}
+
+type state struct {
+	sync.RWMutex
+	m map[string]*Update
+}
+
+var pstate = &state{m: make(map[string]*Update)}
+
+// State returns the process-wide schema state.
+func State() *state { return pstate }
+
+// Get returns the schema Update for attr, if one has been parsed.
+func (s *state) Get(attr string) (Update, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	u, ok := s.m[attr]
+	if !ok {
+		return Update{}, false
+	}
+	return *u, true
+}
+
+// BeginBuild registers a pending index build for attr into tokenizer,
+// targeting whichever of attr's two generations isn't currently active,
+// and returns that generation's id. It fails if attr has no schema yet,
+// or already has a build in progress.
+func (s *state) BeginBuild(attr string, tokenizer []string) (byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	u, ok := s.m[attr]
+	if !ok {
+		return 0, x.Errorf("Schema not defined for attr %q", attr)
+	}
+	if u.Pending != nil {
+		return 0, x.Errorf("Index build already in progress for attr %q", attr)
+	}
+	gen := byte(1) - u.ActiveGen
+	u.Pending = &PendingBuild{Tokenizer: tokenizer, Gen: gen}
+	return gen, nil
+}
+
+// CommitBuild promotes attr's pending generation to active, swapping in
+// its tokenizer config, and returns the generation id and tokenizer list
+// that were active before the swap, so the caller can sweep that
+// generation's now-superseded entries.
+func (s *state) CommitBuild(attr string) (byte, []string, error) {
+	s.Lock()
+	defer s.Unlock()
+	u, ok := s.m[attr]
+	if !ok {
+		return 0, nil, x.Errorf("Schema not defined for attr %q", attr)
+	}
+	if u.Pending == nil {
+		return 0, nil, x.Errorf("No index build in progress for attr %q", attr)
+	}
+	oldGen, oldTokenizer := u.ActiveGen, u.Tokenizer
+	u.ActiveGen = u.Pending.Gen
+	u.Tokenizer = u.Pending.Tokenizer
+	u.Pending = nil
+	return oldGen, oldTokenizer, nil
+}
+
+// AbortBuild discards attr's pending generation without promoting it,
+// and returns its generation id and tokenizer list so the caller can
+// sweep whatever partial entries it accumulated.
+func (s *state) AbortBuild(attr string) (byte, []string, error) {
+	s.Lock()
+	defer s.Unlock()
+	u, ok := s.m[attr]
+	if !ok {
+		return 0, nil, x.Errorf("Schema not defined for attr %q", attr)
+	}
+	if u.Pending == nil {
+		return 0, nil, x.Errorf("No index build in progress for attr %q", attr)
+	}
+	gen, tokenizer := u.Pending.Gen, u.Pending.Tokenizer
+	u.Pending = nil
+	return gen, tokenizer, nil
+}
+
+// TokenizerNames returns the names of the tokenizers/analyzers registered
+// for attr's index, in the order they were declared in the schema.
+func (s *state) TokenizerNames(attr string) []string {
+	u, ok := s.Get(attr)
+	if !ok {
+		return nil
+	}
+	return u.Tokenizer
+}
+
+var typeNames = map[string]types.TypeID{
+	"bool":     types.BoolID,
+	"int":      types.Int32ID,
+	"float":    types.FloatID,
+	"string":   types.StringID,
+	"date":     types.DateID,
+	"datetime": types.DateTimeID,
+	"geo":      types.GeoID,
+	"uid":      types.UidID,
+	"password": types.PasswordID,
+	"default":  types.DefaultID,
+}
+
+// defaultTokenizer returns the tokenizer name @index with no arguments
+// implies for the given value type.
+func defaultTokenizer(t types.TypeID) string {
+	switch t {
+	case types.Int32ID:
+		return "int"
+	case types.FloatID:
+		return "float"
+	case types.DateID:
+		return "date"
+	case types.DateTimeID:
+		return "datetime"
+	case types.StringID:
+		return "term"
+	default:
+		return "default"
+	}
+}
+
+// ParseBytes parses a schema file: one "predicate: type [@index[(tok,...)]]"
+// declaration per line, and installs the result as the schema for groupId.
+func ParseBytes(data []byte, groupId uint32) error {
+	lines := bytes.Split(data, []byte("\n"))
+	updates := make(map[string]*Update)
+	for _, raw := range lines {
+		line := strings.TrimSpace(string(raw))
+		if line == "" {
+			continue
+		}
+		u, err := parseLine(line)
+		if err != nil {
+			return err
+		}
+		u.Group = groupId
+		updates[u.Predicate] = u
+	}
+
+	pstate.Lock()
+	defer pstate.Unlock()
+	for k, v := range updates {
+		pstate.m[k] = v
+	}
+	return nil
+}
+
+// parseLine parses a single schema declaration line.
+func parseLine(line string) (*Update, error) {
+	directive := ""
+	if idx := strings.Index(line, "@"); idx >= 0 {
+		directive = strings.TrimSpace(line[idx:])
+		line = strings.TrimSpace(line[:idx])
+	}
+
+	parts := strings.SplitN(line, ":", 2)
+	if len(parts) != 2 {
+		return nil, x.Errorf("Invalid schema line: %q", line)
+	}
+	pred := strings.TrimSpace(parts[0])
+	typeName := strings.ToLower(strings.TrimSpace(parts[1]))
+	tid, ok := typeNames[typeName]
+	if !ok {
+		return nil, x.Errorf("Invalid type %q for predicate %q", typeName, pred)
+	}
+
+	u := &Update{Predicate: pred, ValueType: tid}
+	if directive == "" {
+		return u, nil
+	}
+	if !strings.HasPrefix(directive, "@index") {
+		return nil, x.Errorf("Unknown directive %q for predicate %q", directive, pred)
+	}
+	rest := strings.TrimPrefix(directive, "@index")
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		u.Tokenizer = []string{defaultTokenizer(tid)}
+		return u, nil
+	}
+	if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+		return nil, x.Errorf("Invalid @index arguments %q for predicate %q", rest, pred)
+	}
+	args := rest[1 : len(rest)-1]
+	for _, tok := range strings.Split(args, ",") {
+		tok = strings.TrimSpace(tok)
+		if tok != "" {
+			u.Tokenizer = append(u.Tokenizer, tok)
+		}
+	}
+	if len(u.Tokenizer) == 0 {
+		u.Tokenizer = []string{defaultTokenizer(tid)}
+	}
+	return u, nil
+}
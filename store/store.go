@@ -0,0 +1,175 @@
+// Package store wraps the on-disk key-value engine used for posting
+// lists. The real binary links against RocksDB; this is a minimal
+// in-memory stand-in exposing the same Slice/Iterator shaped API so
+// callers don't need to know which engine is underneath.
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// Slice is a handle to a byte slice returned by the store, mirroring the
+// gorocksdb Slice API.
+type Slice struct {
+	data []byte
+}
+
+// Data returns the underlying bytes.
+func (s *Slice) Data() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.data
+}
+
+// Store is a sorted key-value store, keyed by raw byte-string ordering.
+type Store struct {
+	mu   sync.RWMutex
+	vals map[string][]byte
+	keys []string // kept sorted
+}
+
+// NewStore returns a new, empty in-memory store. dir is not used; no
+// data is read from or written to disk.
+func NewStore(dir string) (*Store, error) {
+	return &Store{vals: make(map[string][]byte)}, nil
+}
+
+// Close releases the store's resources.
+func (s *Store) Close() {}
+
+// Get returns the value for key, or an empty Slice (whose Data is nil)
+// if it's absent.
+func (s *Store) Get(key []byte) (*Slice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.vals[string(key)]
+	if !ok {
+		return &Slice{}, nil
+	}
+	return &Slice{data: v}, nil
+}
+
+// SetOne writes a single key-value pair.
+func (s *Store) SetOne(key, val []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setLocked(key, val)
+	return nil
+}
+
+// Delete removes key, if present.
+func (s *Store) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := string(key)
+	if _, ok := s.vals[k]; !ok {
+		return nil
+	}
+	delete(s.vals, k)
+	i := sort.SearchStrings(s.keys, k)
+	s.keys = append(s.keys[:i], s.keys[i+1:]...)
+	return nil
+}
+
+func (s *Store) setLocked(key, val []byte) {
+	k := string(key)
+	if _, ok := s.vals[k]; !ok {
+		i := sort.SearchStrings(s.keys, k)
+		s.keys = append(s.keys, "")
+		copy(s.keys[i+1:], s.keys[i:])
+		s.keys[i] = k
+	}
+	s.vals[k] = val
+}
+
+// WriteBatch atomically applies a batch of key-value writes.
+type WriteBatch struct {
+	s    *Store
+	keys [][]byte
+	vals [][]byte
+}
+
+// NewWriteBatch returns an empty batch bound to s.
+func (s *Store) NewWriteBatch() *WriteBatch {
+	return &WriteBatch{s: s}
+}
+
+// Put stages a write in the batch.
+func (b *WriteBatch) Put(key, val []byte) {
+	b.keys = append(b.keys, key)
+	b.vals = append(b.vals, val)
+}
+
+// WriteBatch commits a previously built batch.
+func (s *Store) WriteBatch(b *WriteBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, k := range b.keys {
+		s.setLocked(k, b.vals[i])
+	}
+	return nil
+}
+
+// Iterator walks keys in sorted order.
+type Iterator struct {
+	s   *Store
+	idx int
+}
+
+// NewIterator returns a new Iterator over s.
+func (s *Store) NewIterator() *Iterator {
+	return &Iterator{s: s}
+}
+
+// Seek positions the iterator at the first key >= key.
+func (it *Iterator) Seek(key []byte) {
+	it.s.mu.RLock()
+	defer it.s.mu.RUnlock()
+	it.idx = sort.SearchStrings(it.s.keys, string(key))
+}
+
+// Next advances the iterator by one key.
+func (it *Iterator) Next() {
+	it.idx++
+}
+
+// Valid reports whether the iterator is positioned on a valid entry.
+func (it *Iterator) Valid() bool {
+	it.s.mu.RLock()
+	defer it.s.mu.RUnlock()
+	return it.idx < len(it.s.keys)
+}
+
+// ValidForPrefix reports whether the iterator is valid and the current
+// key has the given prefix.
+func (it *Iterator) ValidForPrefix(prefix []byte) bool {
+	it.s.mu.RLock()
+	defer it.s.mu.RUnlock()
+	if it.idx >= len(it.s.keys) {
+		return false
+	}
+	k := it.s.keys[it.idx]
+	if len(k) < len(prefix) {
+		return false
+	}
+	return k[:len(prefix)] == string(prefix)
+}
+
+// Key returns the current key.
+func (it *Iterator) Key() *Slice {
+	it.s.mu.RLock()
+	defer it.s.mu.RUnlock()
+	return &Slice{data: []byte(it.s.keys[it.idx])}
+}
+
+// Value returns the current value.
+func (it *Iterator) Value() *Slice {
+	it.s.mu.RLock()
+	defer it.s.mu.RUnlock()
+	return &Slice{data: it.s.vals[it.s.keys[it.idx]]}
+}
+
+// Close releases the iterator's resources.
+func (it *Iterator) Close() {}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"strconv"
+	"time"
+)
+
+// TypeID enumerates the scalar types a predicate's value can hold.
+type TypeID byte
+
+const (
+	BoolID TypeID = iota
+	Int32ID
+	FloatID
+	StringID
+	DateID
+	DateTimeID
+	GeoID
+	UidID
+	PasswordID
+	DefaultID
+)
+
+// IntID is an alias kept for readability at call sites that mean
+// "the integer type", since Int32ID is dgraph's historical name for it.
+const IntID = Int32ID
+
+// Val wraps a value together with the TypeID it should be interpreted as.
+type Val struct {
+	Tid   TypeID
+	Value []byte
+}
+
+// ParseInt parses v (as produced by Val for an Int32ID/DefaultID value)
+// into an int64.
+func ParseInt(v []byte) (int64, error) {
+	return strconv.ParseInt(string(v), 10, 64)
+}
+
+// ParseFloat parses v into a float64.
+func ParseFloat(v []byte) (float64, error) {
+	return strconv.ParseFloat(string(v), 64)
+}
+
+// ParseDate parses v, formatted as "2006-01-02", into a time.Time. The
+// year must be exactly four digits; a signed year is not accepted.
+func ParseDate(v []byte) (time.Time, error) {
+	return time.Parse("2006-01-02", string(v))
+}
+
+// ParseDateTime parses v, an RFC3339-ish timestamp, into a time.Time.
+func ParseDateTime(v []byte) (time.Time, error) {
+	s := string(v)
+	layouts := []string{
+		"2006-01-02T15:04:05.000000000",
+		time.RFC3339Nano,
+		time.RFC3339,
+	}
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,46 @@
+package x
+
+import (
+	"fmt"
+	"log"
+)
+
+// Check logs and exits the process if err is non-nil. It is meant for
+// errors that indicate a corrupt on-disk state or programmer mistake,
+// not for errors that should be returned up the call stack.
+func Check(err error) {
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+// Checkf is like Check but allows a formatted message to be attached.
+func Checkf(err error, format string, args ...interface{}) {
+	if err != nil {
+		log.Fatalf("%s: %+v", fmt.Sprintf(format, args...), err)
+	}
+}
+
+// Fatalf logs the formatted message and exits the process.
+func Fatalf(format string, args ...interface{}) {
+	log.Fatalf(format, args...)
+}
+
+// Errorf returns a formatted error.
+func Errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format, args...)
+}
+
+// AssertTrue logs and exits the process if b is false.
+func AssertTrue(b bool) {
+	if !b {
+		log.Fatalf("Assertion failed")
+	}
+}
+
+// AssertTruef is like AssertTrue but allows a formatted message.
+func AssertTruef(b bool, format string, args ...interface{}) {
+	if !b {
+		log.Fatalf(format, args...)
+	}
+}
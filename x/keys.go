@@ -0,0 +1,152 @@
+package x
+
+import (
+	"encoding/binary"
+)
+
+// Key byte markers. The first byte of every key identifies what kind of
+// key it is, so iteration can be scoped to a single keyspace with a
+// simple prefix seek.
+const (
+	byteData            = 0x00
+	byteIndex           = 0x02
+	byteReverse         = 0x01
+	byteRebuildProgress = 0x03
+)
+
+// writeAttr returns attr prefixed with its big-endian uint16 length, so
+// keys for different attrs never collide as prefixes of one another.
+func writeAttr(attr string) []byte {
+	buf := make([]byte, 2+len(attr))
+	binary.BigEndian.PutUint16(buf[0:2], uint16(len(attr)))
+	copy(buf[2:], attr)
+	return buf
+}
+
+func readAttr(key []byte) (attr string, rest []byte) {
+	n := binary.BigEndian.Uint16(key[0:2])
+	return string(key[2 : 2+n]), key[2+n:]
+}
+
+// DataKey generates a key for the data posting list of the given attr/uid.
+func DataKey(attr string, uid uint64) []byte {
+	buf := make([]byte, 0, 1+2+len(attr)+8)
+	buf = append(buf, byteData)
+	buf = append(buf, writeAttr(attr)...)
+	uidBuf := make([]byte, 8)
+	binary.BigEndian.PutUint64(uidBuf, uid)
+	return append(buf, uidBuf...)
+}
+
+// IndexKey generates a key for the index posting list of the given attr,
+// keyed by term. term is expected to already carry its tokenizer-id
+// prefix byte, so multiple tokenizers on the same attr don't collide.
+func IndexKey(attr, term string) []byte {
+	buf := make([]byte, 0, 1+2+len(attr)+len(term))
+	buf = append(buf, byteIndex)
+	buf = append(buf, writeAttr(attr)...)
+	return append(buf, term...)
+}
+
+// ReverseKey generates a key for the reverse edge posting list.
+func ReverseKey(attr string, uid uint64) []byte {
+	buf := make([]byte, 0, 1+2+len(attr)+8)
+	buf = append(buf, byteReverse)
+	buf = append(buf, writeAttr(attr)...)
+	uidBuf := make([]byte, 8)
+	binary.BigEndian.PutUint64(uidBuf, uid)
+	return append(buf, uidBuf...)
+}
+
+// RebuildProgressKey generates the key under which posting.rebuildGen
+// persists shard's progress within attr's rebuild of generation gen, so
+// a resumed rebuild knows where that shard left off. It lives in its
+// own keyspace (byteRebuildProgress) so it can never collide with a
+// data, index or reverse key, and is scoped by gen so an active-gen
+// rebuild and a pending-gen backfill on the same attr never share
+// progress state.
+func RebuildProgressKey(attr string, gen byte, shard uint32) []byte {
+	buf := make([]byte, 0, 1+2+len(attr)+1+4)
+	buf = append(buf, byteRebuildProgress)
+	buf = append(buf, writeAttr(attr)...)
+	buf = append(buf, gen)
+	shardBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(shardBuf, shard)
+	return append(buf, shardBuf...)
+}
+
+// rebuildShardCountMarker is a shard id no real shard ever uses (shards
+// are numbered from 0 up), reserved so RebuildShardCountKey can share
+// RebuildProgressKey's keyspace without ever colliding with a real
+// shard's own progress marker.
+const rebuildShardCountMarker = ^uint32(0)
+
+// RebuildShardCountKey generates the key under which a rebuild of
+// attr's generation gen records the NumWorkers it was sharded into.
+// Shard boundaries are derived from NumWorkers, so resuming with a
+// different NumWorkers would match each shard's old progress marker
+// against a uid range it was never responsible for; the rebuild checks
+// this key on Resume and refuses to continue if NumWorkers changed.
+func RebuildShardCountKey(attr string, gen byte) []byte {
+	return RebuildProgressKey(attr, gen, rebuildShardCountMarker)
+}
+
+// ParsedKey holds the decoded fields of a key produced by DataKey,
+// IndexKey or ReverseKey.
+type ParsedKey struct {
+	byteType byte
+	Attr     string
+	Uid      uint64
+	Term     string
+}
+
+// Parse decodes a raw key back into its ParsedKey form.
+func Parse(key []byte) *ParsedKey {
+	p := &ParsedKey{byteType: key[0]}
+	attr, rest := readAttr(key[1:])
+	p.Attr = attr
+	switch p.byteType {
+	case byteData, byteReverse:
+		p.Uid = binary.BigEndian.Uint64(rest)
+	case byteIndex:
+		p.Term = string(rest)
+	}
+	return p
+}
+
+// IsData returns whether the key is a data posting list key.
+func (p ParsedKey) IsData() bool { return p.byteType == byteData }
+
+// IsIndex returns whether the key is an index posting list key.
+func (p ParsedKey) IsIndex() bool { return p.byteType == byteIndex }
+
+// IsReverse returns whether the key is a reverse posting list key.
+func (p ParsedKey) IsReverse() bool { return p.byteType == byteReverse }
+
+// DataPrefix returns the prefix shared by all data keys for p.Attr.
+func (p ParsedKey) DataPrefix() []byte {
+	buf := make([]byte, 0, 1+2+len(p.Attr))
+	buf = append(buf, byteData)
+	return append(buf, writeAttr(p.Attr)...)
+}
+
+// IndexPrefix returns the prefix shared by all index keys for p.Attr,
+// across every tokenizer registered on that attr.
+func (p ParsedKey) IndexPrefix() []byte {
+	buf := make([]byte, 0, 1+2+len(p.Attr))
+	buf = append(buf, byteIndex)
+	return append(buf, writeAttr(p.Attr)...)
+}
+
+// TokenizerPrefix returns the prefix shared by all index keys for
+// p.Attr that were produced by the tokenizer identified by id.
+func (p ParsedKey) TokenizerPrefix(id byte) []byte {
+	return append(p.IndexPrefix(), id)
+}
+
+// ReversePrefix returns the prefix shared by all reverse keys for p.Attr.
+func (p ParsedKey) ReversePrefix() []byte {
+	buf := make([]byte, 0, 1+2+len(p.Attr))
+	buf = append(buf, byteReverse)
+	return append(buf, writeAttr(p.Attr)...)
+}